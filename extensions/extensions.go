@@ -0,0 +1,84 @@
+// Package extensions lets external, possibly cgo-linked, builds contribute
+// additional heap allocation samples (jemalloc, tcmalloc, a custom malloc
+// wrapper, ...) that get merged into the standard Go heap profile before it
+// is written to file or shipped to the agent.
+//
+// The core profiler package never imports cgo or any native dependencies;
+// it only calls into whatever augmenters have been registered here, so
+// pulling in a native allocator's profile support is entirely opt-in for
+// the binaries that need it.
+package extensions
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/google/pprof/profile"
+)
+
+// HeapAugmenter returns its own allocation samples as a profile to be
+// merged into an existing Go heap profile, given for reference (e.g. to
+// match units). The returned profile must contain only the augmenter's own
+// new samples, not existing's, and must share existing's sample-type
+// schema; an incompatible result is skipped with a logged warning rather
+// than breaking collection.
+type HeapAugmenter func(existing *profile.Profile) (*profile.Profile, error)
+
+var (
+	mu         sync.Mutex
+	augmenters []HeapAugmenter
+)
+
+// RegisterHeapAugmenter adds fn to the set of augmenters consulted by
+// Apply. Typically called from an init() function in a build that links
+// against a native allocator.
+func RegisterHeapAugmenter(fn HeapAugmenter) {
+	mu.Lock()
+	defer mu.Unlock()
+	augmenters = append(augmenters, fn)
+}
+
+// Apply runs every registered augmenter over existing, merging each result
+// in turn. warn is called with a human-readable message whenever an
+// augmenter fails or returns an incompatible profile, so the caller can log
+// it with its own logger; a skipped augmenter never aborts collection.
+func Apply(existing *profile.Profile, warn func(string)) (*profile.Profile, error) {
+	mu.Lock()
+	fns := make([]HeapAugmenter, len(augmenters))
+	copy(fns, augmenters)
+	mu.Unlock()
+
+	merged := existing
+	for _, fn := range fns {
+		next, err := fn(merged)
+		if err != nil {
+			warn(fmt.Sprintf("heap augmenter failed: %v", err))
+			continue
+		}
+		if !compatible(merged, next) {
+			warn("heap augmenter returned an incompatible sample-type schema, skipping")
+			continue
+		}
+		combined, err := profile.Merge([]*profile.Profile{merged, next})
+		if err != nil {
+			warn(fmt.Sprintf("merging augmented heap profile failed: %v", err))
+			continue
+		}
+		merged = combined
+	}
+	return merged, nil
+}
+
+// compatible reports whether b's sample types line up with a's, which
+// profile.Merge requires of its inputs.
+func compatible(a, b *profile.Profile) bool {
+	if len(a.SampleType) != len(b.SampleType) {
+		return false
+	}
+	for i, st := range a.SampleType {
+		if st.Type != b.SampleType[i].Type || st.Unit != b.SampleType[i].Unit {
+			return false
+		}
+	}
+	return true
+}
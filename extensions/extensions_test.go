@@ -0,0 +1,105 @@
+package extensions
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/pprof/profile"
+)
+
+func sampleProfile(value int64) *profile.Profile {
+	return &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "alloc_space", Unit: "bytes"}},
+		PeriodType: &profile.ValueType{Type: "space", Unit: "bytes"},
+		Period:     1,
+		Sample: []*profile.Sample{
+			{Value: []int64{value}},
+		},
+	}
+}
+
+func totalValue(p *profile.Profile) int64 {
+	var total int64
+	for _, s := range p.Sample {
+		for _, v := range s.Value {
+			total += v
+		}
+	}
+	return total
+}
+
+// TestApplyMergesWithoutDoubleCounting verifies that an augmenter returning
+// only its own new samples (per the HeapAugmenter contract) does not get
+// its contribution double-counted by Apply's merge.
+func TestApplyMergesWithoutDoubleCounting(t *testing.T) {
+	defer func(orig []HeapAugmenter) { augmenters = orig }(augmenters)
+	augmenters = nil
+
+	RegisterHeapAugmenter(func(existing *profile.Profile) (*profile.Profile, error) {
+		return sampleProfile(50), nil
+	})
+
+	existing := sampleProfile(100)
+	merged, err := Apply(existing, func(string) {})
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+
+	if got, want := totalValue(merged), int64(150); got != want {
+		t.Fatalf("merged total = %d, want %d (existing 100 + augmenter's own 50, not re-added)", got, want)
+	}
+}
+
+// TestApplySkipsIncompatibleAugmenter verifies a schema-incompatible
+// augmenter result is skipped with a warning instead of aborting or
+// corrupting the profile.
+func TestApplySkipsIncompatibleAugmenter(t *testing.T) {
+	defer func(orig []HeapAugmenter) { augmenters = orig }(augmenters)
+	augmenters = nil
+
+	RegisterHeapAugmenter(func(existing *profile.Profile) (*profile.Profile, error) {
+		return &profile.Profile{
+			SampleType: []*profile.ValueType{{Type: "inuse_objects", Unit: "count"}},
+			PeriodType: &profile.ValueType{Type: "space", Unit: "bytes"},
+			Period:     1,
+			Sample:     []*profile.Sample{{Value: []int64{1}}},
+		}, nil
+	})
+
+	existing := sampleProfile(100)
+	var warnings []string
+	merged, err := Apply(existing, func(msg string) { warnings = append(warnings, msg) })
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if len(warnings) != 1 {
+		t.Fatalf("expected exactly one warning about the incompatible schema, got %v", warnings)
+	}
+	if got, want := totalValue(merged), int64(100); got != want {
+		t.Fatalf("merged total = %d, want %d (incompatible augmenter should be skipped)", got, want)
+	}
+}
+
+// TestApplyLogsFailingAugmenter verifies an augmenter that errors is
+// skipped with a warning rather than aborting collection.
+func TestApplyLogsFailingAugmenter(t *testing.T) {
+	defer func(orig []HeapAugmenter) { augmenters = orig }(augmenters)
+	augmenters = nil
+
+	RegisterHeapAugmenter(func(existing *profile.Profile) (*profile.Profile, error) {
+		return nil, fmt.Errorf("native allocator unavailable")
+	})
+
+	existing := sampleProfile(100)
+	var warnings []string
+	merged, err := Apply(existing, func(msg string) { warnings = append(warnings, msg) })
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if len(warnings) != 1 {
+		t.Fatalf("expected exactly one warning about the failing augmenter, got %v", warnings)
+	}
+	if got, want := totalValue(merged), int64(100); got != want {
+		t.Fatalf("merged total = %d, want %d (failing augmenter should be skipped)", got, want)
+	}
+}
@@ -0,0 +1,131 @@
+package profiler
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// CPUProfileAlignment controls when, within a scheduled collection cycle,
+// the CPU profile window is taken relative to the other profile types.
+type CPUProfileAlignment int
+
+const (
+	// AlignStart starts the CPU profile at the beginning of the cycle,
+	// alongside every other collector. This is the default and matches the
+	// original behavior.
+	AlignStart CPUProfileAlignment = iota
+
+	// AlignEnd delays every collector, not just cpu, so they all start
+	// interval-duration into the cycle and the cpu profile finishes right at
+	// the end of it, overlapping with the other collectors instead of
+	// finishing before the CPU window opens.
+	AlignEnd
+
+	// AlignOverlap runs the CPU profile for the full interval instead of
+	// cfg.duration, so it always overlaps with collection of every other
+	// profile type regardless of how they're scheduled.
+	AlignOverlap
+)
+
+// SetCPUProfileAlignment controls when the CPU profile window falls within
+// each cycle of the scheduled loop started by Start. It has no effect on
+// ad-hoc CollectSnapshot calls, which always align the CPU profile to the
+// start of the call. Defaults to AlignStart.
+func (cfg *Config) SetCPUProfileAlignment(mode CPUProfileAlignment) {
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+	cfg.cpuAlignment = mode
+}
+
+// scheduledSnapshot collects one cycle of the scheduled loop, honoring
+// cfg.cpuAlignment. It takes a single settings snapshot up front so every
+// collector in the cycle sees the same view of the config.
+func (cfg *Config) scheduledSnapshot(ctx context.Context, cs CollectorSet) ([]byte, error) {
+	s := cfg.settings()
+	switch s.cpuAlignment {
+	case AlignEnd:
+		return cfg.collectAlignEnd(ctx, s, cs)
+	case AlignOverlap:
+		return cfg.collectAlignOverlap(ctx, s, cs)
+	default:
+		return cfg.CollectSnapshot(ctx, cs)
+	}
+}
+
+// sleepCtx waits for d or until ctx is cancelled, whichever comes first.
+func sleepCtx(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+// collectAlignEnd delays every collector until interval-duration into the
+// cycle, so they all overlap with the cpu profile's window at the end of it.
+func (cfg *Config) collectAlignEnd(ctx context.Context, s snapshotSettings, cs CollectorSet) ([]byte, error) {
+	delay := s.interval - s.duration
+	if delay < 0 {
+		delay = 0
+	}
+
+	results := make(chan collectResult, len(cs.ProfileTypes))
+	var wg sync.WaitGroup
+	for _, pt := range cs.ProfileTypes {
+		pt := pt
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sleepCtx(ctx, delay)
+			data, err := cfg.collectProfile(ctx, s, pt)
+			if err == nil {
+				cfg.emitProfile(s, pt, data, "")
+			}
+			results <- collectResult{name: pt, data: data, err: err}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	return cfg.finishSnapshot(s, results, "")
+}
+
+// collectAlignOverlap runs the CPU profile for the full cycle interval
+// instead of cfg.duration, and starts the other collectors partway through
+// it, so every profile type overlaps with CPU collection.
+func (cfg *Config) collectAlignOverlap(ctx context.Context, s snapshotSettings, cs CollectorSet) ([]byte, error) {
+	results := make(chan collectResult, len(cs.ProfileTypes))
+	var wg sync.WaitGroup
+	for _, pt := range cs.ProfileTypes {
+		pt := pt
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var data []byte
+			var err error
+			if pt == cpu {
+				data, err = cfg.collectCPUProfileFor(ctx, s.interval)
+				if err == nil {
+					data, err = cfg.applyLabels(s, data)
+				}
+			} else {
+				sleepCtx(ctx, s.interval/2)
+				data, err = cfg.collectProfile(ctx, s, pt)
+			}
+			if err == nil {
+				cfg.emitProfile(s, pt, data, "")
+			}
+			results <- collectResult{name: pt, data: data, err: err}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	return cfg.finishSnapshot(s, results, "")
+}
@@ -0,0 +1,152 @@
+package profiler
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// busyLoop burns CPU until stop is closed, so tests can assert that work
+// running concurrently with a collection window actually shows up in the
+// resulting cpu profile.
+//
+//go:noinline
+func busyLoop(stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+			for i := 0; i < 1e6; i++ {
+			}
+		}
+	}
+}
+
+func zipEntry(t *testing.T, bundle []byte, name string) []byte {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(bundle), int64(len(bundle)))
+	if err != nil {
+		t.Fatalf("reading snapshot zip: %v", err)
+	}
+	for _, f := range zr.File {
+		if f.Name != name {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("opening %s: %v", name, err)
+		}
+		defer rc.Close()
+		var buf bytes.Buffer
+		if _, err := buf.ReadFrom(rc); err != nil {
+			t.Fatalf("reading %s: %v", name, err)
+		}
+		return buf.Bytes()
+	}
+	t.Fatalf("zip bundle has no entry %q", name)
+	return nil
+}
+
+// TestCollectAlignEndCapturesConcurrentWork verifies that AlignEnd's delayed
+// collection window actually overlaps with ongoing work: a synthetic busy
+// loop kept running across the whole collectAlignEnd call must show up as
+// samples in the resulting cpu.pprof.
+func TestCollectAlignEndCapturesConcurrentWork(t *testing.T) {
+	cfg := NewProfilerConfig("align-end-test")
+	cfg.SetInterval(2)
+	cfg.SetCPUProfileDuration(1)
+	s := cfg.settings()
+
+	stop := make(chan struct{})
+	go busyLoop(stop)
+	defer close(stop)
+
+	bundle, err := cfg.collectAlignEnd(context.Background(), s, CollectorSet{Name: "test", ProfileTypes: []string{cpu, heap}})
+	if err != nil {
+		t.Fatalf("collectAlignEnd: %v", err)
+	}
+
+	cpuData := zipEntry(t, bundle, "cpu.pprof")
+	prof, err := profile.Parse(bytes.NewReader(cpuData))
+	if err != nil {
+		t.Fatalf("parsing cpu profile: %v", err)
+	}
+	if len(prof.Sample) == 0 {
+		t.Fatal("expected cpu.pprof to contain samples from the concurrently running busy loop")
+	}
+
+	found := false
+	for _, fn := range prof.Function {
+		if fn.Name == "github.com/upendrasahu/sf-go-profiler/profiler.busyLoop" {
+			found = true
+			break
+		}
+	}
+	if !found {
+		t.Fatal("expected cpu.pprof to contain a sample from busyLoop, meaning collection overlapped with it")
+	}
+}
+
+// TestCollectAlignEndDelaysEveryCollector checks that non-cpu collectors in
+// an AlignEnd cycle do not fire at t=0; they should wait out the same delay
+// as cpu so their lookup/label/emit work actually falls inside the cpu
+// profiling window instead of completing long before it opens.
+func TestCollectAlignEndDelaysEveryCollector(t *testing.T) {
+	cfg := NewProfilerConfig("align-end-delay-test")
+	cfg.SetInterval(2)
+	cfg.SetCPUProfileDuration(1)
+	s := cfg.settings()
+
+	start := time.Now()
+	if _, err := cfg.collectAlignEnd(context.Background(), s, CollectorSet{Name: "test", ProfileTypes: []string{heap}}); err != nil {
+		t.Fatalf("collectAlignEnd: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < s.interval-s.duration {
+		t.Fatalf("heap collector returned after %v, expected it to wait out the %v delay", elapsed, s.interval-s.duration)
+	}
+}
+
+// TestCollectAlignEndWritesSnapshotBundle verifies that AlignEnd goes
+// through the same dump-to-file / GC path as the default scheduler, instead
+// of silently skipping the zip bundle once a user opts into it.
+func TestCollectAlignEndWritesSnapshotBundle(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	cfg := NewProfilerConfig("align-end-bundle-test")
+	cfg.WriteProfileToFile()
+	cfg.SetInterval(0)
+	cfg.SetCPUProfileDuration(0)
+	s := cfg.settings()
+
+	if _, err := cfg.collectAlignEnd(context.Background(), s, CollectorSet{Name: "test", ProfileTypes: []string{heap}}); err != nil {
+		t.Fatalf("collectAlignEnd: %v", err)
+	}
+
+	entries, err := os.ReadDir(DefaultProfilesDir)
+	if err != nil {
+		t.Fatalf("reading %s: %v", DefaultProfilesDir, err)
+	}
+	found := false
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".zip") {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal("expected a .zip snapshot bundle to be written by AlignEnd, same as the default alignment")
+	}
+}
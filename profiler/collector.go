@@ -0,0 +1,406 @@
+package profiler
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/pprof/profile"
+
+	"github.com/upendrasahu/sf-go-profiler/extensions"
+)
+
+// CollectorSet names a subset of profile types to collect as one snapshot.
+type CollectorSet struct {
+	Name         string
+	ProfileTypes []string
+}
+
+// DefaultCollectorSet returns a CollectorSet covering every profile type
+// currently enabled on cfg.
+func (cfg *Config) DefaultCollectorSet() CollectorSet {
+	cfg.mu.RLock()
+	defer cfg.mu.RUnlock()
+	profileTypes := make([]string, len(cfg.profileTypes))
+	copy(profileTypes, cfg.profileTypes)
+	return CollectorSet{Name: "default", ProfileTypes: profileTypes}
+}
+
+// versionInfo is written into a snapshot bundle as version.json, identifying
+// where and when the bundle was collected.
+type versionInfo struct {
+	GoVersion string           `json:"go_version"`
+	Hostname  string           `json:"hostname"`
+	PID       int              `json:"pid"`
+	Service   string           `json:"service"`
+	Timestamp int64            `json:"timestamp"`
+	MemStats  runtime.MemStats `json:"mem_stats"`
+}
+
+type collectResult struct {
+	name string
+	data []byte
+	err  error
+}
+
+// Start begins the periodic profile collection loop in a background
+// goroutine, collecting one snapshot per cfg.interval until ctx is
+// cancelled or Stop is called. Start returns immediately.
+func (cfg *Config) Start(ctx context.Context) {
+	cfg.mu.Lock()
+	cfg.baseCtx = ctx
+	ctx, cancel := context.WithCancel(ctx)
+	cfg.cancel = cancel
+	cfg.mu.Unlock()
+
+	go cfg.pollTriggers(ctx)
+	go cfg.runTraceLoop(ctx)
+
+	go func() {
+		ticker := time.NewTicker(cfg.settings().interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := cfg.scheduledSnapshot(ctx, cfg.DefaultCollectorSet()); err != nil {
+					cfg.logf("scheduled snapshot collection failed: %v", err)
+				}
+				// Re-read in case SetInterval was called mid-cycle, so a
+				// runtime interval change actually takes effect starting
+				// next cycle instead of being silently ignored until the
+				// next Stop/Start.
+				ticker.Reset(cfg.settings().interval)
+			}
+		}
+	}()
+}
+
+// Stop cancels the background collection loop started by Start.
+func (cfg *Config) Stop() {
+	cfg.mu.Lock()
+	cancel := cfg.cancel
+	cfg.cancel = nil
+	cfg.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// CollectSnapshot runs every collector in set (or cfg.DefaultCollectorSet if
+// none is given) concurrently and packages the results into one zip bundle,
+// alongside the existing per-file dump / HTTP POST paths.
+func (cfg *Config) CollectSnapshot(ctx context.Context, set ...CollectorSet) ([]byte, error) {
+	cs := cfg.DefaultCollectorSet()
+	if len(set) > 0 {
+		cs = set[0]
+	}
+	return cfg.collectSnapshotTagged(ctx, cs, "")
+}
+
+// collectSnapshotTagged is the shared implementation behind CollectSnapshot
+// and triggered snapshots. tag is empty for periodic/ad-hoc collection and
+// set to the firing trigger's description for threshold-triggered ones.
+// Cancelling ctx aborts any in-flight CPU profile collection.
+func (cfg *Config) collectSnapshotTagged(ctx context.Context, cs CollectorSet, tag string) ([]byte, error) {
+	s := cfg.settings()
+
+	results := make(chan collectResult, len(cs.ProfileTypes))
+	var wg sync.WaitGroup
+	for _, pt := range cs.ProfileTypes {
+		pt := pt
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			data, err := cfg.collectProfile(ctx, s, pt)
+			if err == nil {
+				cfg.emitProfile(s, pt, data, tag)
+			}
+			results <- collectResult{name: pt, data: data, err: err}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	return cfg.finishSnapshot(s, results, tag)
+}
+
+// finishSnapshot bundles collector results into a zip and, if
+// WriteProfileToFile is set, dumps it to disk and runs gcProfiles. Every
+// snapshot path, under every CPU alignment mode, goes through this.
+func (cfg *Config) finishSnapshot(s snapshotSettings, results <-chan collectResult, tag string) ([]byte, error) {
+	bundle, err := cfg.bundle(s, results)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.dumpToFile {
+		if err := cfg.writeSnapshotFile(s, bundle, tag); err != nil {
+			cfg.logf("writing snapshot bundle to file failed: %v", err)
+		}
+	}
+
+	return bundle, nil
+}
+
+// bundle drains results into a zip archive plus a version.json manifest.
+func (cfg *Config) bundle(s snapshotSettings, results <-chan collectResult) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	for r := range results {
+		if r.err != nil {
+			cfg.logf("collecting %s profile failed: %v", r.name, r.err)
+			continue
+		}
+		f, err := zw.Create(r.name + ".pprof")
+		if err != nil {
+			return nil, fmt.Errorf("creating zip entry for %s: %w", r.name, err)
+		}
+		if _, err := f.Write(r.data); err != nil {
+			return nil, fmt.Errorf("writing zip entry for %s: %w", r.name, err)
+		}
+	}
+
+	vf, err := zw.Create("version.json")
+	if err != nil {
+		return nil, fmt.Errorf("creating version.json entry: %w", err)
+	}
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	vi := versionInfo{
+		GoVersion: runtime.Version(),
+		Hostname:  hostname(),
+		PID:       os.Getpid(),
+		Service:   s.service,
+		Timestamp: time.Now().Unix(),
+		MemStats:  ms,
+	}
+	if err := json.NewEncoder(vf).Encode(vi); err != nil {
+		return nil, fmt.Errorf("encoding version.json: %w", err)
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("closing snapshot zip: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// collectProfile captures a single named profile type, labels it and
+// returns the result as an encoded pprof profile. CPU profiling runs for
+// s.duration, or until ctx is cancelled, whichever comes first.
+func (cfg *Config) collectProfile(ctx context.Context, s snapshotSettings, name string) ([]byte, error) {
+	var data []byte
+	var err error
+	if name == cpu {
+		data, err = cfg.collectCPUProfileFor(ctx, s.duration)
+	} else {
+		data, err = cfg.collectLookupProfile(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cfg.applyLabels(s, data)
+}
+
+// collectLookupProfile captures a profile via runtime/pprof.Lookup, the
+// path for every profile type except cpu.
+func (cfg *Config) collectLookupProfile(name string) ([]byte, error) {
+	p := pprof.Lookup(name)
+	if p == nil {
+		return nil, fmt.Errorf("unknown profile type %q", name)
+	}
+	var buf bytes.Buffer
+	if err := p.WriteTo(&buf, 0); err != nil {
+		return nil, err
+	}
+
+	if name == heap {
+		return cfg.augmentHeapProfile(buf.Bytes())
+	}
+	return buf.Bytes(), nil
+}
+
+// applyLabels decorates every sample in an encoded pprof profile with
+// labels identifying the service, environment, version, host, pid and any
+// user-supplied tags added via Config.AddTag, then re-serializes it.
+func (cfg *Config) applyLabels(s snapshotSettings, data []byte) ([]byte, error) {
+	prof, err := profile.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("parsing profile: %w", err)
+	}
+
+	labels := map[string][]string{
+		"service": {s.service},
+		"host":    {hostname()},
+		"pid":     {strconv.Itoa(os.Getpid())},
+	}
+	if s.env != "" {
+		labels["env"] = []string{s.env}
+	}
+	if s.version != "" {
+		labels["version"] = []string{s.version}
+	}
+	for k, v := range s.tags {
+		labels[k] = []string{v}
+	}
+
+	for _, sample := range prof.Sample {
+		if sample.Label == nil {
+			sample.Label = make(map[string][]string, len(labels))
+		}
+		for k, v := range labels {
+			sample.Label[k] = v
+		}
+	}
+
+	var out bytes.Buffer
+	if err := prof.Write(&out); err != nil {
+		return nil, fmt.Errorf("re-serializing labeled profile: %w", err)
+	}
+	return out.Bytes(), nil
+}
+
+// augmentHeapProfile merges any registered extensions.HeapAugmenter output
+// (e.g. a cgo/native allocator profile) into the standard Go heap profile.
+// It is a no-op, returning data unchanged, if nothing is registered.
+func (cfg *Config) augmentHeapProfile(data []byte) ([]byte, error) {
+	prof, err := profile.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("parsing heap profile: %w", err)
+	}
+
+	merged, err := extensions.Apply(prof, func(msg string) { cfg.logf("%s", msg) })
+	if err != nil {
+		return nil, fmt.Errorf("applying heap augmenters: %w", err)
+	}
+
+	var out bytes.Buffer
+	if err := merged.Write(&out); err != nil {
+		return nil, fmt.Errorf("re-serializing augmented heap profile: %w", err)
+	}
+	return out.Bytes(), nil
+}
+
+// cpuProfileMu serializes access to the process-wide CPU profiler, since
+// runtime/pprof only ever allows one active CPU profile at a time.
+var cpuProfileMu sync.Mutex
+
+// collectCPUProfileFor runs the CPU profiler for d, or until ctx is
+// cancelled, whichever comes first. After d it returns the collected
+// profile; on cancellation it stops the profiler and returns ctx.Err() with
+// no data.
+func (cfg *Config) collectCPUProfileFor(ctx context.Context, d time.Duration) ([]byte, error) {
+	cpuProfileMu.Lock()
+	defer cpuProfileMu.Unlock()
+
+	var buf bytes.Buffer
+	if err := pprof.StartCPUProfile(&buf); err != nil {
+		return nil, err
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		pprof.StopCPUProfile()
+		return nil, ctx.Err()
+	}
+	pprof.StopCPUProfile()
+	return buf.Bytes(), nil
+}
+
+// emitProfile wraps a collected profile in the existing profileData shape
+// and hands it to the file-dump / HTTP POST consumer. tag, when non-empty,
+// records the trigger that caused this profile to be collected.
+func (cfg *Config) emitProfile(s snapshotSettings, name string, data []byte, tag string) {
+	pd := profileData{
+		commonData: commonData{
+			Timestamp: time.Now().Unix(),
+			Type:      name,
+			PID:       os.Getpid(),
+			Service:   s.service,
+			GoVersion: runtime.Version(),
+			Hostname:  hostname(),
+			Trigger:   tag,
+		},
+		Data: data,
+	}
+
+	select {
+	case cfg.outProfile <- pd:
+	default:
+		cfg.logf("outProfile channel full, dropping %s profile", name)
+	}
+
+	if s.dumpToFile {
+		if err := cfg.writeProfileFile(s, pd); err != nil {
+			cfg.logf("writing %s profile to file failed: %v", pd.Type, err)
+		}
+	}
+	if err := cfg.postProfile(s, pd); err != nil {
+		cfg.logf("posting %s profile to agent failed: %v", pd.Type, err)
+	}
+}
+
+func (cfg *Config) writeProfileFile(s snapshotSettings, pd profileData) error {
+	if err := os.MkdirAll(DefaultProfilesDir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s_%d_%d.%s", s.service, pd.Timestamp, pd.PID, pd.Type)
+	return os.WriteFile(DefaultProfilesDir+"/"+name, pd.Data, 0o644)
+}
+
+func (cfg *Config) postProfile(s snapshotSettings, pd profileData) error {
+	body, err := json.Marshal(pd)
+	if err != nil {
+		return err
+	}
+	resp, err := http.Post(s.targetURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("agent returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (cfg *Config) writeSnapshotFile(s snapshotSettings, data []byte, tag string) error {
+	if err := os.MkdirAll(DefaultProfilesDir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s_%d_%d.zip", s.service, time.Now().Unix(), os.Getpid())
+	if err := os.WriteFile(DefaultProfilesDir+"/"+name, data, 0o644); err != nil {
+		return err
+	}
+	if tag != "" {
+		cfg.mu.Lock()
+		cfg.lastTriggeredFile = name
+		cfg.mu.Unlock()
+	}
+	cfg.gcProfiles(DefaultProfilesDir)
+	return nil
+}
+
+func hostname() string {
+	h, err := os.Hostname()
+	if err != nil {
+		return "unknown"
+	}
+	return h
+}
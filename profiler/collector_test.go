@@ -0,0 +1,53 @@
+package profiler
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestCollectCPUProfileForAbortsOnContextCancel verifies that cancelling ctx
+// stops an in-flight CPU profile instead of waiting out its full duration,
+// so an HTTP client disconnecting from /debug/profiler/snapshot can actually
+// abort a multi-second collection.
+func TestCollectCPUProfileForAbortsOnContextCancel(t *testing.T) {
+	cfg := NewProfilerConfig("cancel-test")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+
+	start := time.Now()
+	_, err := cfg.collectCPUProfileFor(ctx, 10*time.Second)
+	elapsed := time.Since(start)
+
+	if err != context.Canceled {
+		t.Fatalf("collectCPUProfileFor err = %v, want context.Canceled", err)
+	}
+	if elapsed > time.Second {
+		t.Fatalf("collectCPUProfileFor took %v to return after cancellation, expected it to abort promptly", elapsed)
+	}
+}
+
+// TestStartPicksUpIntervalChange verifies that SetInterval called after
+// Start affects the already-running scheduler loop, rather than only taking
+// effect on the next Stop/Start.
+func TestStartPicksUpIntervalChange(t *testing.T) {
+	cfg := NewProfilerConfig("interval-change-test")
+	cfg.SetInterval(10)
+	cfg.SetCPUProfileDuration(0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cfg.Start(ctx)
+
+	cfg.SetInterval(1)
+
+	select {
+	case <-cfg.outProfile:
+	case <-time.After(3 * time.Second):
+		t.Fatal("scheduler did not pick up the shortened interval within 3s")
+	}
+}
@@ -3,8 +3,11 @@ package profiler
 import (
 	"context"
 	"log"
+	"net/http"
 	"os"
 	"runtime"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -50,6 +53,10 @@ type commonData struct {
 	Service   string `json:"service,omitempty"`
 	GoVersion string `json:"go_version,omitempty"`
 	Hostname  string `json:"hostname,omitempty"`
+	// Trigger identifies the threshold (e.g. "goroutines>1000") that caused
+	// an ad-hoc snapshot, distinguishing it from periodic samples. Empty for
+	// profiles collected by the interval scheduler.
+	Trigger string `json:"trigger,omitempty"`
 }
 type profileData struct {
 	commonData
@@ -62,17 +69,34 @@ type metricsData struct {
 	MemStats      runtime.MemStats `json:"mem_stats,omitempty"`
 }
 type Config struct {
-	duration     time.Duration
-	interval     time.Duration
-	profileTypes []string
-	cancel       context.CancelFunc
-	outProfile   chan profileData
-	outMetrics   chan metricsData
-	service      string
-	dumpToFile   bool
-	targetURL    string
-	customTarget bool
-	logf         func(format string, v ...interface{})
+	// mu guards every field below, since the Set*/Enable* methods (including
+	// the PATCH /debug/profiler/config handler) can be called concurrently
+	// with the background goroutines Start launches to read them.
+	// traceWriting is the exception: it is an atomic and is used without mu.
+	mu                sync.RWMutex
+	duration          time.Duration
+	interval          time.Duration
+	profileTypes      []string
+	cancel            context.CancelFunc
+	outProfile        chan profileData
+	outMetrics        chan metricsData
+	service           string
+	dumpToFile        bool
+	targetURL         string
+	customTarget      bool
+	logf              func(format string, v ...interface{})
+	cpuAlignment      CPUProfileAlignment
+	triggers          []*trigger
+	lastTriggeredFile string
+	env               string
+	version           string
+	tags              map[string]string
+	baseCtx           context.Context
+	debugAuth         func(*http.Request) bool
+	traceEnabled      bool
+	traceDuration     time.Duration
+	traceInterval     time.Duration
+	traceWriting      atomic.Bool
 }
 
 // NewProfilerConfig returns profiler config
@@ -80,62 +104,100 @@ type Config struct {
 // Accepts service name as argument, service name is required for identification
 func NewProfilerConfig(service string) *Config {
 	return &Config{
-		service:      service,
-		duration:     DefaultCPUProfileDuration,
-		interval:     DefaultProfileInterval,
-		profileTypes: defaultProfiles,
-		outProfile:   make(chan profileData, len(allProfiles)+1),
-		outMetrics:   make(chan metricsData, 1),
-		dumpToFile:   false,
-		targetURL:    DefaultAgentURL,
-		customTarget: false,
-		logf:         defaultlogf,
+		service:       service,
+		duration:      DefaultCPUProfileDuration,
+		interval:      DefaultProfileInterval,
+		profileTypes:  defaultProfiles,
+		outProfile:    make(chan profileData, len(allProfiles)+1),
+		outMetrics:    make(chan metricsData, 1),
+		dumpToFile:    false,
+		targetURL:     DefaultAgentURL,
+		customTarget:  false,
+		logf:          defaultlogf,
+		cpuAlignment:  AlignStart,
+		traceDuration: DefaultTraceDuration,
+		traceInterval: DefaultTraceInterval,
 	}
 }
 
 // SetInterval sets interval between profiles collection
 func (cfg *Config) SetInterval(i int) {
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
 	cfg.interval = time.Duration(i) * time.Second
 }
 
 // SetCPUProfileDuration sets duration in seconds for which cpu profile is collected
 func (cfg *Config) SetCPUProfileDuration(i int) {
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
 	cfg.duration = time.Duration(i) * time.Second
 }
 
 // EnableBlockProfile enables block profile
 func (cfg *Config) EnableBlockProfile() {
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
 	cfg.profileTypes = append(cfg.profileTypes, block)
 }
 
 // EnableMutexProfile enables mutex profile
 func (cfg *Config) EnableMutexProfile() {
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
 	cfg.profileTypes = append(cfg.profileTypes, mutex)
 }
 
+// SetMutexProfileFraction enables mutex profiling at runtime via
+// runtime.SetMutexProfileFraction, so that 1/rate of mutex contention
+// events are reported. Without this, EnableMutexProfile only adds "mutex"
+// to profileTypes and the collected profile is empty, since the runtime
+// never records any contention events on its own.
+func (cfg *Config) SetMutexProfileFraction(rate int) {
+	runtime.SetMutexProfileFraction(rate)
+}
+
+// SetBlockProfileRate enables block profiling at runtime via
+// runtime.SetBlockProfileRate. Without this, EnableBlockProfile only adds
+// "block" to profileTypes and the collected profile is empty, since the
+// runtime never records any blocking events on its own.
+func (cfg *Config) SetBlockProfileRate(rate int) {
+	runtime.SetBlockProfileRate(rate)
+}
+
 // EnableGoRoutineProfile enables goroutine profile
 func (cfg *Config) EnableGoRoutineProfile() {
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
 	cfg.profileTypes = append(cfg.profileTypes, goroutine)
 }
 
 // EnableThreadCreateProfile enables threadcreate profile
 func (cfg *Config) EnableThreadCreateProfile() {
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
 	cfg.profileTypes = append(cfg.profileTypes, threadcreate)
 }
 
 // EnableAllProfiles enables all currently supported profile types
 func (cfg *Config) EnableAllProfiles() {
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
 	cfg.profileTypes = allProfiles
 }
 
 // WriteProfileToFile writes all collected profiles to file to DefaultProfilesDir directory,
 // with file name formatted as service_timestamp_pid.profiletype
 func (cfg *Config) WriteProfileToFile() {
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
 	cfg.dumpToFile = true
 }
 
 // SetTargetURL sets target url to given string, useful for changing where profiles are sent
 func (cfg *Config) SetTargetURL(url string) {
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
 	cfg.customTarget = true
 	cfg.targetURL = url
 }
@@ -143,5 +205,74 @@ func (cfg *Config) SetTargetURL(url string) {
 // SetLogger allows to set custom logger
 // logger function format func(format string, v ...interface{})
 func (cfg *Config) SetLogger(logf func(format string, v ...interface{})) {
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
 	cfg.logf = logf
+}
+
+// SetEnv sets the environment label (e.g. "staging", "prod") attached to
+// every sample of every profile collected afterwards.
+func (cfg *Config) SetEnv(env string) {
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+	cfg.env = env
+}
+
+// SetVersion sets the service version label attached to every sample of
+// every profile collected afterwards.
+func (cfg *Config) SetVersion(version string) {
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+	cfg.version = version
+}
+
+// AddTag attaches a user-supplied key/value label to every sample of every
+// profile collected afterwards, alongside the built-in service/env/version/
+// host/pid labels.
+func (cfg *Config) AddTag(k, v string) {
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+	if cfg.tags == nil {
+		cfg.tags = make(map[string]string)
+	}
+	cfg.tags[k] = v
+}
+
+// snapshotSettings is a point-in-time, lock-free copy of the scheduling and
+// labeling settings that the collection goroutines need repeatedly, taken
+// under cfg.mu so callers never touch the mutable Config fields directly.
+type snapshotSettings struct {
+	duration     time.Duration
+	interval     time.Duration
+	profileTypes []string
+	cpuAlignment CPUProfileAlignment
+	service      string
+	env          string
+	version      string
+	tags         map[string]string
+	dumpToFile   bool
+	targetURL    string
+}
+
+func (cfg *Config) settings() snapshotSettings {
+	cfg.mu.RLock()
+	defer cfg.mu.RUnlock()
+	profileTypes := make([]string, len(cfg.profileTypes))
+	copy(profileTypes, cfg.profileTypes)
+	tags := make(map[string]string, len(cfg.tags))
+	for k, v := range cfg.tags {
+		tags[k] = v
+	}
+	return snapshotSettings{
+		duration:     cfg.duration,
+		interval:     cfg.interval,
+		profileTypes: profileTypes,
+		cpuAlignment: cfg.cpuAlignment,
+		service:      cfg.service,
+		env:          cfg.env,
+		version:      cfg.version,
+		tags:         tags,
+		dumpToFile:   cfg.dumpToFile,
+		targetURL:    cfg.targetURL,
+	}
 }
\ No newline at end of file
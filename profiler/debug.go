@@ -0,0 +1,159 @@
+package profiler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"runtime/pprof"
+	"time"
+)
+
+// RegisterHandlers wires the profiler's debug endpoints onto mux:
+//
+//   - GET  /debug/profiler/snapshot  a freshly collected multi-profile zip bundle
+//   - GET  /debug/profiler/stacks    full goroutine stack dump (debug=2), for deadlock diagnosis
+//   - GET  /debug/profiler/config    the current config
+//   - POST/PATCH /debug/profiler/config  mutate interval, duration or profile types at runtime
+//
+// Every endpoint is gated by cfg.debugAuth, set via Config.SetDebugAuth, if
+// one has been configured.
+func RegisterHandlers(mux *http.ServeMux, cfg *Config) {
+	mux.HandleFunc("/debug/profiler/snapshot", cfg.authorize(cfg.handleSnapshot))
+	mux.HandleFunc("/debug/profiler/stacks", cfg.authorize(cfg.handleStacks))
+	mux.HandleFunc("/debug/profiler/config", cfg.authorize(cfg.handleConfig))
+}
+
+// StartDebugServer starts an HTTP server on addr exposing the endpoints
+// registered by RegisterHandlers. It returns once the listener is up;
+// serving happens in a background goroutine.
+func (cfg *Config) StartDebugServer(addr string) error {
+	mux := http.NewServeMux()
+	RegisterHandlers(mux, cfg)
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("starting debug server: %w", err)
+	}
+
+	go func() {
+		if err := http.Serve(ln, mux); err != nil {
+			cfg.logf("debug server stopped: %v", err)
+		}
+	}()
+	return nil
+}
+
+// SetDebugAuth gates the debug endpoints behind check; requests for which
+// check returns false are rejected with 403. Unset, the endpoints are open,
+// so production deployments should always set this.
+func (cfg *Config) SetDebugAuth(check func(*http.Request) bool) {
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+	cfg.debugAuth = check
+}
+
+func (cfg *Config) authorize(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cfg.mu.RLock()
+		debugAuth := cfg.debugAuth
+		cfg.mu.RUnlock()
+		if debugAuth != nil && !debugAuth(r) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		h(w, r)
+	}
+}
+
+func (cfg *Config) handleSnapshot(w http.ResponseWriter, r *http.Request) {
+	data, err := cfg.CollectSnapshot(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s_snapshot.zip", cfg.settings().service))
+	w.Write(data)
+}
+
+func (cfg *Config) handleStacks(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if err := pprof.Lookup(goroutine).WriteTo(w, 2); err != nil {
+		cfg.logf("writing goroutine stack dump failed: %v", err)
+	}
+}
+
+// configView is the JSON shape returned by GET /debug/profiler/config.
+type configView struct {
+	Service      string   `json:"service"`
+	IntervalSec  int      `json:"interval_seconds"`
+	DurationSec  int      `json:"duration_seconds"`
+	ProfileTypes []string `json:"profile_types"`
+	TargetURL    string   `json:"target_url"`
+	DumpToFile   bool     `json:"dump_to_file"`
+}
+
+// configPatch is the JSON body accepted by POST/PATCH /debug/profiler/config.
+// A nil field leaves the corresponding setting unchanged.
+type configPatch struct {
+	IntervalSeconds *int     `json:"interval_seconds"`
+	DurationSeconds *int     `json:"duration_seconds"`
+	ProfileTypes    []string `json:"profile_types"`
+}
+
+func (cfg *Config) handleConfig(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		cfg.writeConfigView(w)
+	case http.MethodPost, http.MethodPatch:
+		var patch configPatch
+		if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		cfg.applyConfigPatch(patch)
+		cfg.writeConfigView(w)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (cfg *Config) writeConfigView(w http.ResponseWriter) {
+	s := cfg.settings()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(configView{
+		Service:      s.service,
+		IntervalSec:  int(s.interval / time.Second),
+		DurationSec:  int(s.duration / time.Second),
+		ProfileTypes: s.profileTypes,
+		TargetURL:    s.targetURL,
+		DumpToFile:   s.dumpToFile,
+	})
+}
+
+// applyConfigPatch updates interval, duration and/or profile types at
+// runtime and, if the collection loop is currently running, safely
+// restarts it via the existing cancel context so the new settings take
+// effect on the next cycle.
+func (cfg *Config) applyConfigPatch(patch configPatch) {
+	if patch.IntervalSeconds != nil {
+		cfg.SetInterval(*patch.IntervalSeconds)
+	}
+	if patch.DurationSeconds != nil {
+		cfg.SetCPUProfileDuration(*patch.DurationSeconds)
+	}
+	if patch.ProfileTypes != nil {
+		cfg.mu.Lock()
+		cfg.profileTypes = patch.ProfileTypes
+		cfg.mu.Unlock()
+	}
+
+	cfg.mu.RLock()
+	cancel, baseCtx := cfg.cancel, cfg.baseCtx
+	cfg.mu.RUnlock()
+	if cancel != nil && baseCtx != nil {
+		cfg.Stop()
+		cfg.Start(baseCtx)
+	}
+}
@@ -0,0 +1,122 @@
+package profiler
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// TestCollectProfileHasExpectedLabels verifies that every profile type
+// produces a decodable pprof file whose samples carry the expected
+// service/env/version/host/pid and user-supplied tags.
+func TestCollectProfileHasExpectedLabels(t *testing.T) {
+	cfg := NewProfilerConfig("labels-test")
+	cfg.SetEnv("staging")
+	cfg.SetVersion("v1.2.3")
+	cfg.AddTag("team", "infra")
+	cfg.SetCPUProfileDuration(1)
+
+	for _, name := range []string{cpu, heap, goroutine, threadcreate} {
+		name := name
+		t.Run(name, func(t *testing.T) {
+			if name == cpu {
+				// The cpu profile only gets samples while a goroutine is
+				// actually running on a CPU, so keep one busy for the
+				// duration of the collection.
+				stop := make(chan struct{})
+				go busyLoop(stop)
+				defer close(stop)
+			}
+
+			s := cfg.settings()
+			data, err := cfg.collectProfile(context.Background(), s, name)
+			if err != nil {
+				t.Fatalf("collectProfile(%s): %v", name, err)
+			}
+
+			prof, err := profile.Parse(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("profile.Parse(%s): %v", name, err)
+			}
+			if len(prof.Sample) == 0 {
+				t.Fatalf("%s profile has no samples", name)
+			}
+
+			want := map[string]string{
+				"service": "labels-test",
+				"env":     "staging",
+				"version": "v1.2.3",
+				"team":    "infra",
+			}
+			labels := prof.Sample[0].Label
+			for k, v := range want {
+				got := labels[k]
+				if len(got) != 1 || got[0] != v {
+					t.Errorf("%s profile sample missing label %s=%q, got %v", name, k, v, got)
+				}
+			}
+			if len(labels["host"]) != 1 || labels["host"][0] == "" {
+				t.Errorf("%s profile sample missing host label", name)
+			}
+			if len(labels["pid"]) != 1 {
+				t.Errorf("%s profile sample missing pid label", name)
+			}
+		})
+	}
+}
+
+// TestSetMutexProfileFractionAndBlockProfileRate verifies that enabling
+// mutex/block profiling actually engages the runtime collectors, not just
+// Config.profileTypes, so the resulting profiles are non-empty once
+// contention occurs.
+func TestSetMutexProfileFractionAndBlockProfileRate(t *testing.T) {
+	cfg := NewProfilerConfig("rate-test")
+	cfg.SetMutexProfileFraction(1)
+	cfg.SetBlockProfileRate(1)
+
+	contend(t)
+
+	s := cfg.settings()
+	for _, name := range []string{mutex, block} {
+		data, err := cfg.collectProfile(context.Background(), s, name)
+		if err != nil {
+			t.Fatalf("collectProfile(%s): %v", name, err)
+		}
+		prof, err := profile.Parse(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("profile.Parse(%s): %v", name, err)
+		}
+		if len(prof.Sample) == 0 {
+			t.Errorf("%s profile has no samples; expected the matching runtime.Set*Rate/Fraction call to have been engaged", name)
+		}
+	}
+}
+
+// contend generates a little mutex contention and channel blocking so the
+// mutex and block profilers have something to record.
+func contend(t *testing.T) {
+	t.Helper()
+
+	var mu sync.Mutex
+	mu.Lock()
+	unlocked := make(chan struct{})
+	go func() {
+		mu.Lock() // contends with the lock held by the parent goroutine below
+		mu.Unlock()
+		close(unlocked)
+	}()
+	time.Sleep(50 * time.Millisecond) // give the goroutine time to block on mu.Lock
+	mu.Unlock()
+	<-unlocked
+
+	blocked := make(chan struct{})
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		close(blocked)
+	}()
+	<-blocked // blocks on a channel receive, for the block profiler
+}
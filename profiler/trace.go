@@ -0,0 +1,105 @@
+package profiler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"runtime/trace"
+	"time"
+)
+
+const profileTypeTrace = "trace"
+
+// DefaultTraceDuration is how long an execution trace runs for by default.
+// Traces are far heavier than CPU profiles, so they default to a much
+// shorter window than cfg.duration.
+const DefaultTraceDuration = 2 * time.Second
+
+// DefaultTraceInterval is how often, by default, an execution trace is
+// collected once EnableExecutionTrace has been called -- decoupled from,
+// and much slower than, the main profile interval.
+const DefaultTraceInterval = 10 * DefaultProfileInterval
+
+// EnableExecutionTrace turns on periodic runtime/trace collection,
+// decoupled from the main interval loop via SetTraceInterval and
+// SetTraceDuration.
+func (cfg *Config) EnableExecutionTrace() {
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+	cfg.traceEnabled = true
+}
+
+// SetTraceDuration sets how long each execution trace runs for.
+func (cfg *Config) SetTraceDuration(d time.Duration) {
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+	cfg.traceDuration = d
+}
+
+// SetTraceInterval sets how often an execution trace is collected,
+// independent of the main profile interval.
+func (cfg *Config) SetTraceInterval(d time.Duration) {
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+	cfg.traceInterval = d
+}
+
+func (cfg *Config) traceSettings() (enabled bool, duration, interval time.Duration) {
+	cfg.mu.RLock()
+	defer cfg.mu.RUnlock()
+	return cfg.traceEnabled, cfg.traceDuration, cfg.traceInterval
+}
+
+// runTraceLoop runs alongside the interval scheduler, collecting an
+// execution trace every cfg.traceInterval once EnableExecutionTrace has
+// been called. It polls current trace settings every
+// DefaultTriggerPollInterval, so calling EnableExecutionTrace/SetTraceInterval
+// after Start still takes effect, and skips a cycle rather than overlapping
+// if the previous trace is still writing.
+func (cfg *Config) runTraceLoop(ctx context.Context) {
+	ticker := time.NewTicker(DefaultTriggerPollInterval)
+	defer ticker.Stop()
+
+	var lastRun time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			enabled, _, interval := cfg.traceSettings()
+			if !enabled || time.Since(lastRun) < interval {
+				continue
+			}
+			lastRun = time.Now()
+
+			if !cfg.traceWriting.CompareAndSwap(false, true) {
+				cfg.logf("skipping trace collection, previous trace is still writing")
+				continue
+			}
+			go func() {
+				defer cfg.traceWriting.Store(false)
+				if err := cfg.collectTrace(); err != nil {
+					cfg.logf("collecting execution trace failed: %v", err)
+				}
+			}()
+		}
+	}
+}
+
+// collectTrace captures a runtime/trace execution trace for
+// cfg.traceDuration and ships it through the same file-dump / HTTP POST
+// path as other profile types, tagged Type:"trace" so downstream agents can
+// feed it into `go tool trace`.
+func (cfg *Config) collectTrace() error {
+	_, duration, _ := cfg.traceSettings()
+
+	var buf bytes.Buffer
+	if err := trace.Start(&buf); err != nil {
+		return fmt.Errorf("starting execution trace: %w", err)
+	}
+	time.Sleep(duration)
+	trace.Stop()
+
+	cfg.emitProfile(cfg.settings(), profileTypeTrace, buf.Bytes(), "")
+	return nil
+}
@@ -0,0 +1,124 @@
+package profiler
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// DefaultTriggerPollInterval is how often registered triggers are
+// re-evaluated against current runtime stats.
+const DefaultTriggerPollInterval = 5 * time.Second
+
+// TriggerFunc evaluates current runtime stats and the live goroutine count,
+// returning true when an ad-hoc snapshot should be captured.
+type TriggerFunc func(runtime.MemStats, int) bool
+
+type trigger struct {
+	tag      string
+	cooldown time.Duration
+	check    TriggerFunc
+	lastFire time.Time
+}
+
+// AddTrigger registers a threshold check that runs alongside the interval
+// scheduler. Whenever check returns true, an ad-hoc snapshot is captured and
+// tagged with tag in commonData. cooldown bounds how often this trigger can
+// fire, preventing thrash when a metric hovers near the threshold.
+func (cfg *Config) AddTrigger(tag string, cooldown time.Duration, check TriggerFunc) {
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+	cfg.triggers = append(cfg.triggers, &trigger{tag: tag, cooldown: cooldown, check: check})
+}
+
+// AddGoroutineThreshold fires a tagged snapshot whenever the number of live
+// goroutines exceeds n, at most once per cooldown.
+func (cfg *Config) AddGoroutineThreshold(n int, cooldown time.Duration) {
+	cfg.AddTrigger(fmt.Sprintf("goroutines>%d", n), cooldown, func(_ runtime.MemStats, numGoroutines int) bool {
+		return numGoroutines > n
+	})
+}
+
+// AddHeapThreshold fires a tagged snapshot whenever HeapAlloc exceeds bytes,
+// at most once per cooldown.
+func (cfg *Config) AddHeapThreshold(bytes uint64, cooldown time.Duration) {
+	cfg.AddTrigger(fmt.Sprintf("heap>%d", bytes), cooldown, func(ms runtime.MemStats, _ int) bool {
+		return ms.HeapAlloc > bytes
+	})
+}
+
+// pollTriggers runs in the background alongside the interval scheduler,
+// re-checking registered triggers every DefaultTriggerPollInterval and
+// firing a tagged snapshot when one crosses its threshold. It re-reads the
+// trigger list on every tick, so triggers added after Start still take
+// effect.
+func (cfg *Config) pollTriggers(ctx context.Context) {
+	ticker := time.NewTicker(DefaultTriggerPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			var ms runtime.MemStats
+			runtime.ReadMemStats(&ms)
+			numGoroutines := runtime.NumGoroutine()
+
+			for _, t := range cfg.triggersSnapshot() {
+				if time.Since(t.lastFire) < t.cooldown {
+					continue
+				}
+				if !t.check(ms, numGoroutines) {
+					continue
+				}
+				t.lastFire = time.Now()
+				if _, err := cfg.collectSnapshotTagged(ctx, cfg.DefaultCollectorSet(), t.tag); err != nil {
+					cfg.logf("triggered snapshot (%s) failed: %v", t.tag, err)
+				}
+			}
+		}
+	}
+}
+
+// triggersSnapshot returns a copy of the currently registered triggers, so
+// pollTriggers can safely iterate it while AddTrigger is appended to from
+// other goroutines. The *trigger pointers themselves are shared and still
+// owned exclusively by pollTriggers (lastFire is only ever written there).
+func (cfg *Config) triggersSnapshot() []*trigger {
+	cfg.mu.RLock()
+	defer cfg.mu.RUnlock()
+	triggers := make([]*trigger, len(cfg.triggers))
+	copy(triggers, cfg.triggers)
+	return triggers
+}
+
+// gcProfiles removes profile files in dir older than DefaultProfilesAge,
+// always keeping the most recently written triggered dump on disk even if
+// it has aged out.
+func (cfg *Config) gcProfiles(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	cfg.mu.RLock()
+	lastTriggeredFile := cfg.lastTriggeredFile
+	cfg.mu.RUnlock()
+
+	cutoff := time.Now().Add(-DefaultProfilesAge)
+	for _, e := range entries {
+		if e.Name() == lastTriggeredFile {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, e.Name())); err != nil {
+			cfg.logf("gc: removing %s failed: %v", e.Name(), err)
+		}
+	}
+}